@@ -0,0 +1,111 @@
+/*
+ * cast.go
+ * Record sessions in asciicast v2 format
+ * By J. Stuart McMurray
+ * Created 20180118
+ * Last Modified 20180118
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CAST records the session to disk, or is nil if -r wasn't given.
+var CAST *castWriter
+
+// castHeader is the first line of an asciicast v2 file.
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command"`
+	Env       map[string]string `json:"env"`
+}
+
+// castWriter wraps an io.Writer, recording everything written to it (and,
+// via InputEvent, every line of input) to a cast file as asciicast v2
+// events.  It's safe for concurrent use, since the child's output goroutine
+// and the ReadLine goroutine both use one.
+type castWriter struct {
+	mu    sync.Mutex
+	w     io.Writer /* The real output, e.g. os.Stdout */
+	cast  io.Writer /* The open -r file */
+	start time.Time
+}
+
+// newCastWriter opens fn, writes an asciicast v2 header describing a
+// session of the given size running cmd, and returns a castWriter which
+// records output written through it to fn as well as passing it on to w.
+func newCastWriter(fn string, w io.Writer, width, height int, cmd []string) (*castWriter, error) {
+	f, err := os.Create(fn)
+	if nil != err {
+		return nil, err
+	}
+
+	h := castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: time.Now().Unix(),
+		Command:   strings.Join(cmd, " "),
+		Env: map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	}
+	hb, err := json.Marshal(h)
+	if nil != err {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(f, "%s\n", hb); nil != err {
+		return nil, err
+	}
+
+	return &castWriter{w: w, cast: f, start: time.Now()}, nil
+}
+
+// Write passes p on to c's real writer, then records it as an "o" (output)
+// event.
+func (c *castWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if nil != err {
+		return n, err
+	}
+	return n, c.writeEvent("o", string(p))
+}
+
+// InputEvent records line, with its trailing newline, as an "i" (input)
+// event.
+func (c *castWriter) InputEvent(line string) error {
+	return c.writeEvent("i", line+"\n")
+}
+
+// writeEvent JSON-encodes data and appends it to c.cast as a
+// [elapsed, typ, data] asciicast v2 event.
+func (c *castWriter) writeEvent(typ, data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := json.Marshal(data)
+	if nil != err {
+		return err
+	}
+
+	_, err = fmt.Fprintf(
+		c.cast,
+		"[%f, %q, %s]\n",
+		time.Since(c.start).Seconds(),
+		typ,
+		db,
+	)
+	return err
+}
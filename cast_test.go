@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// decodeEvent parses a single asciicast v2 [elapsed, typ, data] event line.
+func decodeEvent(t *testing.T, line []byte) (typ, data string) {
+	t.Helper()
+	var ev []interface{}
+	if err := json.Unmarshal(line, &ev); nil != err {
+		t.Fatalf("Unmarshal %s: %v", line, err)
+	}
+	if 3 != len(ev) {
+		t.Fatalf("event %s: got %d fields, want 3", line, len(ev))
+	}
+	typ, ok := ev[1].(string)
+	if !ok {
+		t.Fatalf("event %s: typ field isn't a string", line)
+	}
+	data, ok = ev[2].(string)
+	if !ok {
+		t.Fatalf("event %s: data field isn't a string", line)
+	}
+	return typ, data
+}
+
+func TestCastWriterWriteEvent(t *testing.T) {
+	var cast bytes.Buffer
+	c := &castWriter{w: io.Discard, cast: &cast, start: time.Now()}
+
+	if err := c.writeEvent("o", "hello\n"); nil != err {
+		t.Fatalf("writeEvent: %v", err)
+	}
+
+	typ, data := decodeEvent(t, bytes.TrimRight(cast.Bytes(), "\n"))
+	if "o" != typ {
+		t.Errorf("typ: got %q, want %q", typ, "o")
+	}
+	if "hello\n" != data {
+		t.Errorf("data: got %q, want %q", data, "hello\n")
+	}
+}
+
+func TestCastWriterWrite(t *testing.T) {
+	var out, cast bytes.Buffer
+	c := &castWriter{w: &out, cast: &cast, start: time.Now()}
+
+	n, err := c.Write([]byte("child output"))
+	if nil != err {
+		t.Fatalf("Write: %v", err)
+	}
+	if len("child output") != n {
+		t.Errorf("Write: got n=%d, want %d", n, len("child output"))
+	}
+	if "child output" != out.String() {
+		t.Errorf("w: got %q, want %q", out.String(), "child output")
+	}
+
+	typ, data := decodeEvent(t, bytes.TrimRight(cast.Bytes(), "\n"))
+	if "o" != typ {
+		t.Errorf("typ: got %q, want %q", typ, "o")
+	}
+	if "child output" != data {
+		t.Errorf("data: got %q, want %q", data, "child output")
+	}
+}
+
+func TestCastWriterInputEvent(t *testing.T) {
+	var cast bytes.Buffer
+	c := &castWriter{w: io.Discard, cast: &cast, start: time.Now()}
+
+	if err := c.InputEvent("ls -l"); nil != err {
+		t.Fatalf("InputEvent: %v", err)
+	}
+
+	typ, data := decodeEvent(t, bytes.TrimRight(cast.Bytes(), "\n"))
+	if "i" != typ {
+		t.Errorf("typ: got %q, want %q", typ, "i")
+	}
+	if "ls -l\n" != data {
+		t.Errorf("data: got %q, want %q", data, "ls -l\n")
+	}
+}
+
+func TestNewCastWriterHeader(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "session.cast")
+
+	c, err := newCastWriter(fn, io.Discard, 80, 24, []string{"echo", "hi"})
+	if nil != err {
+		t.Fatalf("newCastWriter: %v", err)
+	}
+
+	line, err := readFirstLine(fn)
+	if nil != err {
+		t.Fatalf("readFirstLine: %v", err)
+	}
+
+	var h castHeader
+	if err := json.Unmarshal(line, &h); nil != err {
+		t.Fatalf("Unmarshal header: %v", err)
+	}
+	if 2 != h.Version {
+		t.Errorf("Version: got %d, want 2", h.Version)
+	}
+	if 80 != h.Width || 24 != h.Height {
+		t.Errorf("size: got %dx%d, want 80x24", h.Width, h.Height)
+	}
+	if "echo hi" != h.Command {
+		t.Errorf("Command: got %q, want %q", h.Command, "echo hi")
+	}
+
+	if err := c.writeEvent("o", "x"); nil != err {
+		t.Fatalf("writeEvent: %v", err)
+	}
+}
+
+// readFirstLine returns the first line of fn, without its trailing newline.
+func readFirstLine(fn string) ([]byte, error) {
+	b, err := os.ReadFile(fn)
+	if nil != err {
+		return nil, err
+	}
+	if i := bytes.IndexByte(b, '\n'); 0 <= i {
+		return b[:i], nil
+	}
+	return b, nil
+}
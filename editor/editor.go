@@ -0,0 +1,34 @@
+/*
+ * editor.go
+ * Pluggable line-editor backend
+ * By J. Stuart McMurray
+ * Created 20180125
+ * Last Modified 20180125
+ */
+
+// Package editor defines the interface termwrap's line-editing backends
+// implement, so the program can be built against whichever one the user
+// asks for.
+package editor
+
+// Editor reads lines of input from the user, with prompting, tab
+// completion, and (backend-dependent) history and keymaps.
+type Editor interface {
+	// ReadLine reads and returns a single line of input.  It returns an
+	// error (often io.EOF) when no more input is available.
+	ReadLine() (string, error)
+
+	// SetPrompt sets the prompt displayed before each line.
+	SetPrompt(prompt string)
+
+	// SetCompleter sets the function used to find tab-completions for
+	// the partial word before the cursor.  It may be called from a
+	// different goroutine than ReadLine.
+	SetCompleter(completer func(prefix string) []string)
+
+	// Resize tells the editor the terminal is now w columns by h rows.
+	Resize(w, h int)
+
+	// Close releases any resources held by the editor.
+	Close() error
+}
@@ -0,0 +1,137 @@
+/*
+ * rline.go
+ * editor.Editor with modal Vim/Emacs keymaps, backed by chzyer/readline
+ * By J. Stuart McMurray
+ * Created 20180125
+ * Last Modified 20180125
+ */
+
+// Package rline implements editor.Editor on top of
+// github.com/chzyer/readline, giving termwrap modal (Vim normal/insert/
+// visual) editing, a multi-column completion menu, and a kill-ring, in
+// addition to the Emacs-style editing xterm.Editor already provides.
+package rline
+
+import (
+	"fmt"
+	"io"
+	"unicode"
+
+	"github.com/chzyer/readline"
+)
+
+// Editor implements editor.Editor with github.com/chzyer/readline,
+// supporting both Vim and Emacs keymaps.
+type Editor struct {
+	rl   *readline.Instance
+	comp *completer
+}
+
+// New returns an Editor reading from in and writing to out, with a Vim
+// keymap if vim is true and an Emacs keymap otherwise.  If histFile isn't
+// empty, history is loaded from and appended to it; this can be the same
+// file used by history.Open elsewhere in termwrap, since both just keep
+// one line per entry.
+func New(in io.Reader, out io.Writer, prompt string, vim bool, histFile string) (*Editor, error) {
+	comp := &completer{}
+
+	cfg := &readline.Config{
+		Prompt:          prompt,
+		HistoryFile:     histFile,
+		AutoComplete:    comp,
+		VimMode:         vim,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "",
+		/* readline.Config.Stdin wants an io.ReadCloser; in doesn't
+		need closing (readline never calls Close on it, since its
+		own Init wraps it in a FillableStdin first), so wrap it to
+		satisfy the type. */
+		Stdin:  io.NopCloser(in),
+		Stdout: out,
+		Stderr: out,
+	}
+
+	rl, err := readline.NewEx(cfg)
+	if nil != err {
+		return nil, err
+	}
+
+	return &Editor{rl: rl, comp: comp}, nil
+}
+
+// ReadLine reads a single line of input.  Ctrl+C on a non-empty line
+// clears it and keeps reading, unlike the xterm backend, where any Ctrl+C
+// ends ReadLine with io.EOF; Ctrl+C on an empty line (or Ctrl+D) ends the
+// session by returning an error, for the caller to send to ERRORCHAN.
+func (e *Editor) ReadLine() (string, error) {
+	for {
+		l, err := e.rl.Readline()
+		if readline.ErrInterrupt != err {
+			return l, err
+		}
+		if "" != l {
+			continue
+		}
+		return "", fmt.Errorf("keyboard interrupt")
+	}
+}
+
+// SetPrompt sets the prompt shown before each line.
+func (e *Editor) SetPrompt(prompt string) {
+	e.rl.SetPrompt(prompt)
+}
+
+// SetCompleter sets the function used to find tab-completions.
+func (e *Editor) SetCompleter(completer func(string) []string) {
+	e.comp.fn = completer
+}
+
+// Writer returns the io.Writer the child's output should be written to,
+// so it's interleaved correctly with whatever the user's typed so far.
+func (e *Editor) Writer() io.Writer { return e.rl }
+
+// Resize is a no-op; readline.Instance watches SIGWINCH itself.
+func (e *Editor) Resize(w, h int) {}
+
+// Close releases the resources readline.Instance holds.
+func (e *Editor) Close() error {
+	return e.rl.Close()
+}
+
+// completer adapts a func(prefix string) []string to
+// readline.AutoCompleter, which readline uses to draw its multi-column
+// completion menu.
+type completer struct {
+	fn func(prefix string) []string
+}
+
+// Do implements readline.AutoCompleter.
+func (c *completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	if nil == c.fn {
+		return nil, 0
+	}
+
+	/* Find the word ending at pos */
+	start := pos - 1
+	for ; 0 <= start && !unicode.IsSpace(line[start]); start-- {
+	}
+	start++
+	word := string(line[start:pos])
+
+	ms := c.fn(word)
+	if 0 == len(ms) {
+		return nil, 0
+	}
+
+	/* readline wants the part of each match after what's already
+	typed */
+	nl := make([][]rune, 0, len(ms))
+	for _, m := range ms {
+		if len(m) < len(word) {
+			continue
+		}
+		nl = append(nl, []rune(m[len(word):]))
+	}
+
+	return nl, len(word)
+}
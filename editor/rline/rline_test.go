@@ -0,0 +1,103 @@
+package rline
+
+import "testing"
+
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestCompleterDoWordBoundary makes sure Do only passes the word ending at
+// pos -- not the whole line -- to the completer function.
+func TestCompleterDoWordBoundary(t *testing.T) {
+	var got string
+	c := &completer{fn: func(prefix string) []string {
+		got = prefix
+		return []string{prefix + "bar"}
+	}}
+
+	line := []rune("echo foo")
+	nl, length := c.Do(line, len(line))
+
+	if "foo" != got {
+		t.Errorf("prefix: got %q, want %q", got, "foo")
+	}
+	if 3 != length {
+		t.Errorf("length: got %d, want 3", length)
+	}
+	if 1 != len(nl) || !runesEqual(nl[0], []rune("bar")) {
+		t.Errorf("completions: got %v, want [[bar]]", nl)
+	}
+}
+
+// TestCompleterDoSuffixOnly makes sure Do returns only the part of each
+// match after what's already typed, for readline to splice in.
+func TestCompleterDoSuffixOnly(t *testing.T) {
+	c := &completer{fn: func(prefix string) []string {
+		return []string{"foobar", "foobaz"}
+	}}
+
+	line := []rune("foo")
+	nl, length := c.Do(line, len(line))
+
+	if 3 != length {
+		t.Errorf("length: got %d, want 3", length)
+	}
+	want := [][]rune{[]rune("bar"), []rune("baz")}
+	if len(nl) != len(want) {
+		t.Fatalf("completions: got %v, want %v", nl, want)
+	}
+	for i := range want {
+		if !runesEqual(nl[i], want[i]) {
+			t.Errorf("completions[%d]: got %q, want %q", i, nl[i], want[i])
+		}
+	}
+}
+
+// TestCompleterDoShorterMatchSkipped makes sure a match shorter than what's
+// already typed (which can't be split into a useful suffix) is dropped
+// rather than panicking on a negative slice index.
+func TestCompleterDoShorterMatchSkipped(t *testing.T) {
+	c := &completer{fn: func(prefix string) []string {
+		return []string{"fo", "foobar"}
+	}}
+
+	line := []rune("foo")
+	nl, length := c.Do(line, len(line))
+
+	if 3 != length {
+		t.Errorf("length: got %d, want 3", length)
+	}
+	if 1 != len(nl) || !runesEqual(nl[0], []rune("bar")) {
+		t.Errorf("completions: got %v, want [[bar]]", nl)
+	}
+}
+
+// TestCompleterDoNoMatches makes sure Do returns nothing when the
+// completer finds no matches.
+func TestCompleterDoNoMatches(t *testing.T) {
+	c := &completer{fn: func(prefix string) []string { return nil }}
+
+	nl, length := c.Do([]rune("foo"), 3)
+	if nil != nl || 0 != length {
+		t.Errorf("got (%v, %d), want (nil, 0)", nl, length)
+	}
+}
+
+// TestCompleterDoNoCompleter makes sure Do is a no-op when no completer
+// function has been set.
+func TestCompleterDoNoCompleter(t *testing.T) {
+	c := &completer{}
+
+	nl, length := c.Do([]rune("foo"), 3)
+	if nil != nl || 0 != length {
+		t.Errorf("got (%v, %d), want (nil, 0)", nl, length)
+	}
+}
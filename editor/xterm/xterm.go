@@ -0,0 +1,344 @@
+/*
+ * xterm.go
+ * editor.Editor backed by golang.org/x/term
+ * By J. Stuart McMurray
+ * Created 20180125
+ * Last Modified 20180128
+ */
+
+// Package xterm implements editor.Editor on top of golang.org/x/term's
+// Terminal, which is termwrap's original (Emacs-ish) line-editing
+// behavior.
+package xterm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+
+	"github.com/magisterquis/termwrap/history"
+
+	"golang.org/x/term"
+)
+
+// Key codes not worth pulling in a whole package for.
+const (
+	keyCtrlR = 0x12
+	keyCtrlG = 0x07
+)
+
+// keySearchBackspace stands in for a literal Backspace/Ctrl+H while a
+// Ctrl+R search is in progress.  term.Terminal's handleKey intercepts the
+// real 0x7f/0x08 bytes itself, before AutoCompleteCallback ever sees
+// them, so searchReader swaps them for this private-use rune, which
+// handleKey doesn't recognise and so falls through to the callback.
+const keySearchBackspace = '\uE000'
+
+// Editor implements editor.Editor with golang.org/x/term.
+type Editor struct {
+	t         *term.Terminal
+	hist      *history.History
+	errch     chan<- error
+	completer func(string) []string
+
+	prompt string
+
+	/* Ctrl+R reverse-incremental search state */
+	searching         bool
+	searchBuf         string
+	searchIdx         int
+	searchSavedLine   string
+	searchSavedPrompt string
+}
+
+// New wraps rw in a term.Terminal, using hist for Up/Down history
+// walking (via term.Terminal's own History interface) and Ctrl+R
+// reverse-incremental search.  term.Terminal handles Ctrl+C (on any line)
+// and Ctrl+D on an empty line itself, ending ReadLine with io.EOF before
+// autoComplete sees the key, so those reach the caller as ReadLine's
+// error rather than on errch.
+func New(rw io.ReadWriter, prompt string, hist *history.History, errch chan<- error) *Editor {
+	e := &Editor{
+		hist:      hist,
+		errch:     errch,
+		prompt:    prompt,
+		searchIdx: -1,
+	}
+	e.t = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{&searchReader{r: rw, e: e}, rw}, prompt)
+	e.t.AutoCompleteCallback = e.autoComplete
+	if nil != hist {
+		e.t.History = &histAdapter{h: hist}
+	}
+	return e
+}
+
+// ReadLine reads a single line of input.
+func (e *Editor) ReadLine() (string, error) {
+	l, err := e.t.ReadLine()
+	/* term.Terminal intercepts a real Enter before AutoCompleteCallback
+	ever sees it, so searchKey never gets a chance to end the search the
+	normal way; do it here instead, whenever a line comes back while a
+	search was still open. */
+	if e.searching {
+		e.endSearch()
+	}
+	return l, err
+}
+
+// SetPrompt sets the prompt shown before each line, outside of a Ctrl+R
+// search.
+func (e *Editor) SetPrompt(prompt string) {
+	e.prompt = prompt
+	e.t.SetPrompt(prompt)
+}
+
+// SetCompleter sets the function used to find tab-completions.
+func (e *Editor) SetCompleter(completer func(string) []string) {
+	e.completer = completer
+}
+
+// Writer returns the io.Writer the child's output should be written to,
+// so it's interleaved correctly with whatever the user's typed so far.
+func (e *Editor) Writer() io.Writer { return e.t }
+
+// Resize is a no-op; term.Terminal re-measures its line on the next
+// keypress.
+func (e *Editor) Resize(w, h int) {}
+
+// Close is a no-op; term.Terminal doesn't hold any resources of its
+// own.
+func (e *Editor) Close() error { return nil }
+
+// autoComplete implements term.Terminal's AutoCompleteCallback, providing
+// Ctrl+R search and tab-completion.  Up/Down history walking isn't done
+// here; term.Terminal handles it itself via e.t.History, since it
+// intercepts those keys before this callback ever runs.
+func (e *Editor) autoComplete(
+	line string,
+	pos int,
+	key rune,
+) (newLine string, newPos int, ok bool) {
+	if e.searching {
+		return e.searchKey(line, pos, key)
+	}
+
+	switch key {
+	case 0x03: /* Ctrl+C; term.Terminal returns io.EOF first, see New */
+		/* Quit if it's an empty line */
+		if "" == line {
+			e.errch <- fmt.Errorf("keyboard interrupt")
+			return "", 0, false
+		}
+		/* Clear the line otherwise */
+		return "", 0, true
+	case keyCtrlR: /* Start a reverse-incremental search */
+		e.startSearch(line)
+		return line, pos, true
+	case '\t': /* Tab, for autocomplete */
+		break
+	default:
+		return "", 0, false
+	}
+
+	/* If we have no completer, give up */
+	if nil == e.completer {
+		return "", 0, false
+	}
+
+	/* Get word on which tab was called */
+	start := pos - 1
+	if 0 > start {
+		start = 0
+	}
+	for ; 0 < start && !unicode.IsSpace(rune(line[start-1])); start-- {
+	}
+	word := line[start:pos]
+
+	/* Find matches */
+	ms := e.completer(word)
+	if 0 == len(ms) {
+		return "", 0, false
+	}
+
+	/* Find the longest common prefix */
+	lcp := longestCommonPrefix(ms)
+	if 0 == len(lcp) {
+		return "", 0, false
+	}
+
+	/* Put the prefix into the line */
+	left := line[:start]
+	right := line[pos:]
+	return left + lcp + right, pos + (len(lcp) - len(word)), true
+}
+
+// histAdapter adapts history.History to term.Terminal's History
+// interface (Add, Len, At), so a real Up/Down keypress — which
+// term.Terminal intercepts itself, never reaching AutoCompleteCallback —
+// walks the persistent history, and every submitted line is appended to
+// it automatically.
+type histAdapter struct {
+	h *history.History
+}
+
+// Add implements term.History.
+func (a *histAdapter) Add(entry string) {
+	if err := a.h.Append(entry); nil != err {
+		fmt.Fprintf(os.Stderr, "Unable to save history: %v\r\n", err)
+	}
+}
+
+// Len implements term.History.
+func (a *histAdapter) Len() int { return len(a.h.Lines()) }
+
+// At implements term.History.  Index 0 is the most-recently-added entry.
+func (a *histAdapter) At(idx int) string {
+	ls := a.h.Lines()
+	return ls[len(ls)-1-idx]
+}
+
+// searchReader wraps the reader handed to term.Terminal, substituting
+// keySearchBackspace for a literal Backspace while a Ctrl+R search is in
+// progress; see keySearchBackspace.
+//
+// It hands term.Terminal one byte at a time, rather than whatever's
+// available in a single underlying Read.  term.Terminal only asks for more
+// input once it's fully processed what it already has, so reading one byte
+// at a time guarantees e.searching is up to date for every byte this
+// substitutes, instead of reflecting whatever it was when a multi-byte
+// chunk happened to arrive.
+type searchReader struct {
+	r   io.Reader
+	e   *Editor
+	buf []byte
+}
+
+// Read implements io.Reader.
+func (r *searchReader) Read(p []byte) (int, error) {
+	if 0 == len(p) {
+		return 0, nil
+	}
+
+	if 0 == len(r.buf) {
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if 0 == n {
+			return 0, err
+		}
+		if r.e.searching && (0x7f == b[0] || 0x08 == b[0]) {
+			r.buf = []byte(string(keySearchBackspace))
+		} else {
+			r.buf = b[:1]
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// startSearch begins a reverse-incremental search, remembering line so it
+// can be restored if the search is cancelled.
+func (e *Editor) startSearch(line string) {
+	e.searching = true
+	e.searchBuf = ""
+	e.searchIdx = -1
+	e.searchSavedLine = line
+	e.searchSavedPrompt = e.prompt
+	e.t.SetPrompt(e.searchPrompt())
+}
+
+// endSearch leaves search mode, restoring the normal prompt.
+func (e *Editor) endSearch() {
+	e.searching = false
+	e.t.SetPrompt(e.searchSavedPrompt)
+}
+
+// searchPrompt builds the "(reverse-i-search)`term`:" prompt for the
+// current search buffer.
+func (e *Editor) searchPrompt() string {
+	return fmt.Sprintf("(reverse-i-search)`%v': ", e.searchBuf)
+}
+
+// searchKey handles keystrokes while a reverse-incremental search is in
+// progress.
+func (e *Editor) searchKey(
+	line string,
+	pos int,
+	key rune,
+) (newLine string, newPos int, ok bool) {
+	switch key {
+	case keyCtrlG: /* Cancel, restore the original line */
+		e.endSearch()
+		return e.searchSavedLine, len(e.searchSavedLine), true
+	case keyCtrlR: /* Cycle to the next-older match */
+		if nil != e.hist {
+			if l, i, found := e.hist.ReverseSearch(e.searchBuf, e.searchIdx); found {
+				e.searchIdx = i
+				e.t.SetPrompt(e.searchPrompt())
+				return l, len(l), true
+			}
+		}
+		return line, pos, true
+	case keySearchBackspace: /* Backspace, shrink the search buffer */
+		if 0 != len(e.searchBuf) {
+			e.searchBuf = e.searchBuf[:len(e.searchBuf)-1]
+		}
+	default:
+		if !unicode.IsPrint(key) {
+			return line, pos, true
+		}
+		e.searchBuf += string(key)
+	}
+
+	e.searchIdx = -1
+	if nil == e.hist {
+		e.t.SetPrompt(e.searchPrompt())
+		return "", 0, true
+	}
+	l, i, found := e.hist.ReverseSearch(e.searchBuf, -1)
+	if !found {
+		e.t.SetPrompt(e.searchPrompt())
+		return "", 0, true
+	}
+	e.searchIdx = i
+	e.t.SetPrompt(e.searchPrompt())
+	return l, len(l), true
+}
+
+// longestCommonPrefix finds the longest prefix shared between the
+// strings.
+func longestCommonPrefix(ss []string) string {
+	if 0 == len(ss) {
+		return ""
+	}
+	if 1 == len(ss) {
+		return ss[0]
+	}
+
+	/* Find the min and max strings */
+	min := ss[0]
+	max := ss[0]
+	for _, s := range ss[1:] {
+		if s > max {
+			max = s
+		} else if s < min {
+			min = s
+		}
+	}
+
+	/* The common prefix between the minimum and maximum strings is the
+	prefix common to all strings */
+	pref := ""
+	for i := 0; len(min) > i && len(max) > i; i++ {
+		if min[i] != max[i] {
+			break
+		}
+		pref += string(min[i])
+	}
+	return pref
+}
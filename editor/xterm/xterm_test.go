@@ -0,0 +1,118 @@
+package xterm
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/magisterquis/termwrap/history"
+)
+
+// newTestEditor returns an Editor backed by hist (seeded with lines) whose
+// input is exactly input; the "terminal" output is discarded.  input must
+// contain everything the test intends to read, across however many
+// ReadLine calls it makes.
+func newTestEditor(t *testing.T, lines []string, input []byte) *Editor {
+	t.Helper()
+
+	h, err := history.Open(filepath.Join(t.TempDir(), "hist"), 0)
+	if nil != err {
+		t.Fatalf("history.Open: %v", err)
+	}
+	for _, l := range lines {
+		if err := h.Append(l); nil != err {
+			t.Fatalf("Append %v: %v", l, err)
+		}
+	}
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{bytes.NewReader(input), io.Discard}
+
+	return New(rw, "> ", h, make(chan error, 1))
+}
+
+// TestHistoryWalk makes sure real Up/Down keypresses walk persistent
+// history, against term.Terminal itself rather than the never-invoked
+// AutoCompleteCallback path this used to rely on.
+func TestHistoryWalk(t *testing.T) {
+	up := []byte{0x1b, '[', 'A'} // ESC [ A
+	input := append(append([]byte{}, up...), '\r')
+	input = append(input, up...)
+	input = append(input, up...)
+	input = append(input, '\r')
+
+	e := newTestEditor(t, []string{"echo one", "echo two"}, input)
+
+	l, err := e.ReadLine()
+	if nil != err {
+		t.Fatalf("ReadLine 1: %v", err)
+	}
+	if "echo two" != l {
+		t.Errorf("ReadLine 1: got %q, want %q", l, "echo two")
+	}
+
+	l, err = e.ReadLine()
+	if nil != err {
+		t.Fatalf("ReadLine 2: %v", err)
+	}
+	if "echo one" != l {
+		t.Errorf("ReadLine 2: got %q, want %q", l, "echo one")
+	}
+}
+
+// TestSearchEnterUnsticksEditor makes sure accepting a Ctrl+R search with
+// Enter leaves search mode for good, rather than wedging every later
+// keystroke into searchKey (the documented acceptance path is unreachable
+// from AutoCompleteCallback, since term.Terminal handles a real Enter
+// itself).
+func TestSearchEnterUnsticksEditor(t *testing.T) {
+	var input []byte
+	input = append(input, keyCtrlR)
+	input = append(input, "ba"...)
+	input = append(input, '\r')
+	input = append(input, "hello"...)
+	input = append(input, '\r')
+
+	e := newTestEditor(t, []string{"foo bar", "foo baz", "qux"}, input)
+
+	l, err := e.ReadLine()
+	if nil != err {
+		t.Fatalf("ReadLine 1 (search): %v", err)
+	}
+	if "foo baz" != l {
+		t.Errorf("ReadLine 1 (search): got %q, want %q", l, "foo baz")
+	}
+
+	l, err = e.ReadLine()
+	if nil != err {
+		t.Fatalf("ReadLine 2 (plain): %v", err)
+	}
+	if "hello" != l {
+		t.Errorf("ReadLine 2 (plain): got %q, want %q; search mode "+
+			"may still be stuck on", l, "hello")
+	}
+}
+
+// TestSearchBackspace makes sure Backspace during a Ctrl+R search shrinks
+// the search buffer rather than being silently eaten by term.Terminal,
+// which intercepts the real byte before searchKey ever sees it.
+func TestSearchBackspace(t *testing.T) {
+	var input []byte
+	input = append(input, keyCtrlR)
+	input = append(input, "alphax"...)
+	input = append(input, 0x7f) // Backspace, drops the "x" typo
+	input = append(input, '\r')
+
+	e := newTestEditor(t, []string{"beta", "alphabet"}, input)
+
+	l, err := e.ReadLine()
+	if nil != err {
+		t.Fatalf("ReadLine: %v", err)
+	}
+	if "alphabet" != l {
+		t.Errorf("ReadLine: got %q, want %q", l, "alphabet")
+	}
+}
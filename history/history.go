@@ -0,0 +1,137 @@
+/*
+ * history.go
+ * Persistent, searchable command history
+ * By J. Stuart McMurray
+ * Created 20180116
+ * Last Modified 20180116
+ */
+
+// Package history provides a simple persistent command history, backed by
+// a flat file, with prefix and substring search.
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// History holds a list of previously-entered lines, backed by a file on
+// disk.  It's safe for concurrent use.
+type History struct {
+	mu    sync.Mutex
+	path  string
+	max   int
+	lines []string
+}
+
+// Open loads the history file at path, keeping at most the last max lines
+// (0 means unlimited).  If path doesn't exist, an empty History is returned
+// and the file is created on the first Append.
+func Open(path string, max int) (*History, error) {
+	h := &History{path: path, max: max}
+
+	b, err := ioutil.ReadFile(path)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+
+	for _, l := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		if "" == l {
+			continue
+		}
+		h.lines = append(h.lines, l)
+	}
+	h.trim()
+
+	return h, nil
+}
+
+// Append adds line to the end of the history and saves it to disk.  Empty
+// lines are ignored, as are lines identical to the most recently-added
+// line.
+func (h *History) Append(line string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if "" == line {
+		return nil
+	}
+	if 0 != len(h.lines) && h.lines[len(h.lines)-1] == line {
+		return nil
+	}
+
+	h.lines = append(h.lines, line)
+	h.trim()
+
+	return h.save()
+}
+
+// Lines returns a copy of the history, oldest first.
+func (h *History) Lines() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ls := make([]string, len(h.lines))
+	copy(ls, h.lines)
+
+	return ls
+}
+
+// Search returns the most recently-added line starting with prefix.
+func (h *History) Search(prefix string) (line string, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.lines) - 1; 0 <= i; i-- {
+		if strings.HasPrefix(h.lines[i], prefix) {
+			return h.lines[i], true
+		}
+	}
+
+	return "", false
+}
+
+// ReverseSearch looks backwards from index from (exclusive) for the most
+// recent line containing substr.  Passing -1 for from starts the search at
+// the most recently-added line.  The index of the match is returned so it
+// can be passed back in as from to find the next-older match.
+func (h *History) ReverseSearch(substr string, from int) (line string, idx int, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if -1 == from || len(h.lines) < from {
+		from = len(h.lines)
+	}
+
+	for i := from - 1; 0 <= i; i-- {
+		if strings.Contains(h.lines[i], substr) {
+			return h.lines[i], i, true
+		}
+	}
+
+	return "", -1, false
+}
+
+// trim drops lines from the head of h.lines until it's no longer over
+// h.max.  h.mu must be held by the caller.
+func (h *History) trim() {
+	if 0 >= h.max || len(h.lines) <= h.max {
+		return
+	}
+	h.lines = h.lines[len(h.lines)-h.max:]
+}
+
+// save writes h.lines to h.path, overwriting whatever's there.  h.mu must
+// be held by the caller.
+func (h *History) save() error {
+	return ioutil.WriteFile(
+		h.path,
+		[]byte(strings.Join(h.lines, "\n")+"\n"),
+		0600,
+	)
+}
@@ -0,0 +1,145 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// open returns a fresh History backed by a file under t's temp directory.
+func open(t *testing.T, max int) *History {
+	t.Helper()
+	h, err := Open(filepath.Join(t.TempDir(), "hist"), max)
+	if nil != err {
+		t.Fatalf("Open: %v", err)
+	}
+	return h
+}
+
+func TestHistoryAppend(t *testing.T) {
+	h := open(t, 0)
+
+	if err := h.Append(""); nil != err {
+		t.Fatalf("Append empty: %v", err)
+	}
+	if err := h.Append("foo"); nil != err {
+		t.Fatalf("Append foo: %v", err)
+	}
+	if err := h.Append("foo"); nil != err { /* Consecutive duplicate */
+		t.Fatalf("Append foo again: %v", err)
+	}
+	if err := h.Append("bar"); nil != err {
+		t.Fatalf("Append bar: %v", err)
+	}
+
+	got := h.Lines()
+	want := []string{"foo", "bar"}
+	if len(got) != len(want) {
+		t.Fatalf("Lines: got %q, want %q", got, want)
+	}
+	for i, l := range want {
+		if got[i] != l {
+			t.Errorf("Lines[%d]: got %q, want %q", i, got[i], l)
+		}
+	}
+}
+
+func TestHistoryTrim(t *testing.T) {
+	h := open(t, 2)
+
+	for _, l := range []string{"a", "b", "c"} {
+		if err := h.Append(l); nil != err {
+			t.Fatalf("Append %v: %v", l, err)
+		}
+	}
+
+	got := h.Lines()
+	want := []string{"b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("Lines: got %q, want %q", got, want)
+	}
+	for i, l := range want {
+		if got[i] != l {
+			t.Errorf("Lines[%d]: got %q, want %q", i, got[i], l)
+		}
+	}
+}
+
+func TestHistoryOpenPersists(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "hist")
+
+	h1, err := Open(fn, 0)
+	if nil != err {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := h1.Append("one"); nil != err {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := h1.Append("two"); nil != err {
+		t.Fatalf("Append: %v", err)
+	}
+
+	h2, err := Open(fn, 0)
+	if nil != err {
+		t.Fatalf("Reopen: %v", err)
+	}
+	got := h2.Lines()
+	want := []string{"one", "two"}
+	if len(got) != len(want) {
+		t.Fatalf("Lines: got %q, want %q", got, want)
+	}
+	for i, l := range want {
+		if got[i] != l {
+			t.Errorf("Lines[%d]: got %q, want %q", i, got[i], l)
+		}
+	}
+}
+
+func TestHistorySearch(t *testing.T) {
+	h := open(t, 0)
+	for _, l := range []string{"git status", "go build", "git diff"} {
+		if err := h.Append(l); nil != err {
+			t.Fatalf("Append %v: %v", l, err)
+		}
+	}
+
+	l, ok := h.Search("git")
+	if !ok {
+		t.Fatal("Search(git): no match")
+	}
+	if "git diff" != l {
+		t.Errorf("Search(git): got %q, want %q", l, "git diff")
+	}
+
+	if _, ok := h.Search("svn"); ok {
+		t.Error("Search(svn): unexpected match")
+	}
+}
+
+func TestHistoryReverseSearch(t *testing.T) {
+	h := open(t, 0)
+	for _, l := range []string{"echo one", "echo two", "ls -l"} {
+		if err := h.Append(l); nil != err {
+			t.Fatalf("Append %v: %v", l, err)
+		}
+	}
+
+	l, i, ok := h.ReverseSearch("echo", -1)
+	if !ok {
+		t.Fatal("ReverseSearch(echo, -1): no match")
+	}
+	if "echo two" != l {
+		t.Errorf("ReverseSearch(echo, -1): got %q, want %q", l, "echo two")
+	}
+
+	l, _, ok = h.ReverseSearch("echo", i)
+	if !ok {
+		t.Fatal("ReverseSearch(echo, i): no older match")
+	}
+	if "echo one" != l {
+		t.Errorf("ReverseSearch(echo, i): got %q, want %q", l, "echo one")
+	}
+
+	if _, _, ok := h.ReverseSearch("nope", -1); ok {
+		t.Error("ReverseSearch(nope, -1): unexpected match")
+	}
+}
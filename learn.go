@@ -0,0 +1,156 @@
+/*
+ * learn.go
+ * Thread-safe, live-updatable tab-complete word list
+ * By J. Stuart McMurray
+ * Created 20180122
+ * Last Modified 20180122
+ */
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-immutable-radix"
+)
+
+// tokenRE matches a candidate tab-complete word in a stream of child
+// output.
+var tokenRE = regexp.MustCompile(`[A-Za-z0-9_./-]+`)
+
+// Wordlist is a thread-safe wrapper around an immutable radix tree of
+// tab-complete words, which can be grown live from the child's output.
+type Wordlist struct {
+	mu   sync.RWMutex
+	t    *iradix.Tree
+	max  int      /* 0 means unlimited */
+	ring []string /* Insertion order, oldest first, for LRU eviction */
+}
+
+// NewWordlist returns an empty Wordlist which holds at most max words
+// (0 for unlimited), evicting the oldest-inserted word once max is
+// exceeded.
+func NewWordlist(max int) *Wordlist {
+	return &Wordlist{t: iradix.New(), max: max}
+}
+
+// Insert adds word to w, if it's not already present, evicting the
+// oldest-inserted word if w is over its configured maximum.
+func (w *Wordlist) Insert(word string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.t.Get([]byte(word)); ok {
+		return
+	}
+
+	t, _, _ := w.t.Insert([]byte(word), nil)
+	w.t = t
+	w.ring = append(w.ring, word)
+
+	if 0 < w.max && len(w.ring) > w.max {
+		var evict string
+		evict, w.ring = w.ring[0], w.ring[1:]
+		t, _, _ := w.t.Delete([]byte(evict))
+		w.t = t
+	}
+}
+
+// Snapshot returns the radix tree backing w as it stands right now.
+// Because the tree is immutable, the caller may walk it without locking;
+// concurrent Inserts will build on top of a new tree and won't be seen by
+// a Snapshot already taken.
+func (w *Wordlist) Snapshot() *iradix.Tree {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.t
+}
+
+// Dump writes w's words, one per line, to fn.
+func (w *Wordlist) Dump(fn string) error {
+	t := w.Snapshot()
+
+	var lines []string
+	t.Root().Walk(func(k []byte, v interface{}) bool {
+		lines = append(lines, string(k))
+		return false
+	})
+
+	return ioutil.WriteFile(fn, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// learnWriter tees a child's output to an underlying writer, scanning it
+// for tab-complete words to add to wl.  It's safe for concurrent use, as
+// Wordlist.Insert locks internally.
+type learnWriter struct {
+	mu  sync.Mutex /* Guards rem */
+	w   io.Writer
+	wl  *Wordlist
+	min int
+	rem []byte /* Unfinished token left over from the last Write */
+}
+
+// Write passes p on to l.w, then scans it for words of at least l.min
+// bytes to insert into l.wl.  A token split across two Writes -- which
+// io.Copy from the pty doesn't guard against -- is reassembled first,
+// rather than being learned as two useless fragments.
+func (l *learnWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.w.Write(p)
+	if nil != err {
+		return n, err
+	}
+
+	buf := append(l.rem, p...)
+	l.rem = nil
+
+	ms := tokenRE.FindAllIndex(buf, -1)
+	for i, m := range ms {
+		/* A match reaching the very end of buf might continue in
+		the next Write, so hold it back instead of learning a
+		truncated word. */
+		if i == len(ms)-1 && len(buf) == m[1] {
+			l.rem = append([]byte{}, buf[m[0]:m[1]]...)
+			break
+		}
+		if tok := buf[m[0]:m[1]]; len(tok) >= l.min {
+			l.wl.Insert(string(tok))
+		}
+	}
+
+	return n, nil
+}
+
+// parseAList reads the lines from fn and adds them to WORDLIST, creating
+// it with the given max size if it doesn't already exist.
+func parseAList(fn string, max int) error {
+	if nil == WORDLIST {
+		WORDLIST = NewWordlist(max)
+	}
+
+	f, err := os.Open(fn)
+	if nil != err {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if "" == l {
+			continue
+		}
+		WORDLIST.Insert(l)
+	}
+
+	return s.Err()
+}
+
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWordlistInsert(t *testing.T) {
+	wl := NewWordlist(0)
+	wl.Insert("foo")
+	wl.Insert("bar")
+	wl.Insert("foo") /* Already present */
+
+	var got []string
+	wl.Snapshot().Root().Walk(func(k []byte, v interface{}) bool {
+		got = append(got, string(k))
+		return false
+	})
+	want := []string{"bar", "foo"} /* Radix walk is lexical order */
+	if len(got) != len(want) {
+		t.Fatalf("words: got %q, want %q", got, want)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("words[%d]: got %q, want %q", i, got[i], w)
+		}
+	}
+}
+
+func TestWordlistEviction(t *testing.T) {
+	wl := NewWordlist(2)
+	wl.Insert("one")
+	wl.Insert("two")
+	wl.Insert("three") /* Evicts "one" */
+
+	if _, ok := wl.Snapshot().Get([]byte("one")); ok {
+		t.Error("one: still present after eviction")
+	}
+	for _, w := range []string{"two", "three"} {
+		if _, ok := wl.Snapshot().Get([]byte(w)); !ok {
+			t.Errorf("%v: missing", w)
+		}
+	}
+}
+
+func TestWordlistDump(t *testing.T) {
+	wl := NewWordlist(0)
+	wl.Insert("alpha")
+	wl.Insert("beta")
+
+	fn := filepath.Join(t.TempDir(), "words")
+	if err := wl.Dump(fn); nil != err {
+		t.Fatalf("Dump: %v", err)
+	}
+
+	b, err := os.ReadFile(fn)
+	if nil != err {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if "alpha\nbeta\n" != string(b) {
+		t.Errorf("Dump contents: got %q, want %q", b, "alpha\nbeta\n")
+	}
+}
+
+func TestLearnWriterWrite(t *testing.T) {
+	var out bytes.Buffer
+	wl := NewWordlist(0)
+	lw := &learnWriter{w: &out, wl: wl, min: 4}
+
+	p := []byte("cd /etc/passwd; ls -l a\n")
+	n, err := lw.Write(p)
+	if nil != err {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(p) != n {
+		t.Errorf("Write: got n=%d, want %d", n, len(p))
+	}
+	if out.String() != string(p) {
+		t.Errorf("underlying writer: got %q, want %q", out.String(), p)
+	}
+
+	if _, ok := wl.Snapshot().Get([]byte("/etc/passwd")); !ok {
+		t.Error("/etc/passwd: not learned")
+	}
+	if _, ok := wl.Snapshot().Get([]byte("cd")); ok {
+		t.Error("cd: learned despite being shorter than min")
+	}
+	if _, ok := wl.Snapshot().Get([]byte("a")); ok {
+		t.Error("a: learned despite being shorter than min")
+	}
+}
+
+// TestLearnWriterPartialTokenAcrossWrites makes sure a word split across
+// two Writes -- as io.Copy from a pty does nothing to prevent -- is
+// learned whole, rather than as two useless fragments.
+func TestLearnWriterPartialTokenAcrossWrites(t *testing.T) {
+	var out bytes.Buffer
+	wl := NewWordlist(0)
+	lw := &learnWriter{w: &out, wl: wl, min: 4}
+
+	if _, err := lw.Write([]byte("/etc/pass")); nil != err {
+		t.Fatalf("Write 1: %v", err)
+	}
+	if _, err := lw.Write([]byte("wd\n")); nil != err {
+		t.Fatalf("Write 2: %v", err)
+	}
+
+	if "/etc/passwd\n" != out.String() {
+		t.Errorf("underlying writer: got %q, want %q", out.String(), "/etc/passwd\n")
+	}
+	if _, ok := wl.Snapshot().Get([]byte("/etc/passwd")); !ok {
+		t.Error("/etc/passwd: not learned whole")
+	}
+	if _, ok := wl.Snapshot().Get([]byte("/etc/pass")); ok {
+		t.Error("/etc/pass: learned as a truncated fragment")
+	}
+	if _, ok := wl.Snapshot().Get([]byte("wd")); ok {
+		t.Error("wd: learned as a truncated fragment")
+	}
+}
+
+func TestParseAList(t *testing.T) {
+	old := WORDLIST
+	defer func() { WORDLIST = old }()
+	WORDLIST = nil
+
+	fn := filepath.Join(t.TempDir(), "list")
+	if err := os.WriteFile(
+		fn,
+		[]byte("foo\n\nbar\n  \nbaz\n"),
+		0644,
+	); nil != err {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if err := parseAList(fn, 0); nil != err {
+		t.Fatalf("parseAList: %v", err)
+	}
+
+	for _, w := range []string{"foo", "bar", "baz"} {
+		if _, ok := WORDLIST.Snapshot().Get([]byte(w)); !ok {
+			t.Errorf("%v: missing", w)
+		}
+	}
+}
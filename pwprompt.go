@@ -0,0 +1,168 @@
+/*
+ * pwprompt.go
+ * Detect password prompts in the child's output, read the reply with
+ * echo suppressed
+ * By J. Stuart McMurray
+ * Created 20180128
+ * Last Modified 20180128
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// defaultPWPrompt is the default value of -pwprompt.
+const defaultPWPrompt = `(?i)(password|passphrase|pin)[^:]*:\s*$`
+
+// pwDetector tees a child's output to an underlying writer, watching the
+// bytes since the last newline for something matching re.  On a match, it
+// signals pending (non-blockingly; one outstanding signal is enough) so the
+// next input line can be read with echo suppressed.
+type pwDetector struct {
+	w       io.Writer
+	re      *regexp.Regexp
+	pending chan<- struct{}
+	buf     []byte
+}
+
+// Write passes p on to d.w, then checks the bytes since the last newline
+// against d.re.
+func (d *pwDetector) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	if nil != err {
+		return n, err
+	}
+
+	d.buf = append(d.buf, p...)
+	if i := bytes.LastIndexByte(d.buf, '\n'); 0 <= i {
+		d.buf = d.buf[i+1:]
+	}
+	if d.re.Match(d.buf) {
+		d.buf = nil
+		select {
+		case d.pending <- struct{}{}:
+		default: /* Already have one pending */
+		}
+	}
+
+	return n, nil
+}
+
+// lineResult is a line read either by the line editor or by a no-echo
+// password read, sent to termwrap's proxy-input loop.
+type lineResult struct {
+	line string
+	err  error
+}
+
+// rawStdin reads f a byte at a time into ch until f returns an error (e.g.
+// on EOF, or when the terminal's restored at exit), which is then sent to
+// errc.  It's meant to run in its own goroutine, as the sole reader of f,
+// so a stdinGate downstream can divert input to a no-echo password read
+// even while the line editor's already blocked waiting for the next byte.
+func rawStdin(f *os.File, ch chan<- byte, errc chan<- error) {
+	var b [1]byte
+	for {
+		n, err := f.Read(b[:])
+		if 0 < n {
+			ch <- b[0]
+		}
+		if nil != err {
+			errc <- err
+			return
+		}
+	}
+}
+
+// stdinGate sits between rawStdin and the line editor.  It normally just
+// passes bytes through, but as soon as pending fires -- even if the
+// editor's already blocked waiting for the very next byte, which a plain
+// "check pending before starting a read" can't catch -- it diverts input
+// to a no-echo line read of its own and reports the result on pwLines,
+// before resuming the editor's feed.  This is what keeps a password
+// prompt that appears between two ed.ReadLine calls from having its
+// answer read, echoed, and recorded by the editor as an ordinary line.
+type stdinGate struct {
+	raw     <-chan byte
+	rawErr  <-chan error
+	pending <-chan struct{}
+	pwLines chan<- lineResult
+	err     error
+}
+
+// Read implements io.Reader.  It returns at most one byte at a time, which
+// is all term.Terminal and chzyer/readline ever need to make progress a
+// keystroke at a time, and lets it re-check pending before every byte it
+// hands the editor.
+func (g *stdinGate) Read(p []byte) (int, error) {
+	if 0 == len(p) {
+		return 0, nil
+	}
+	if nil != g.err {
+		return 0, g.err
+	}
+
+	select {
+	case <-g.pending:
+		g.pwLines <- g.readNoEchoLine()
+	default:
+	}
+
+	/* Keep watching pending while blocked, so a prompt that turns up
+	before the next byte still gets that byte. */
+	for nil == g.err {
+		select {
+		case <-g.pending:
+			g.pwLines <- g.readNoEchoLine()
+		case b := <-g.raw:
+			p[0] = b
+			return 1, nil
+		case err := <-g.rawErr:
+			g.err = err
+		}
+	}
+	return 0, g.err
+}
+
+// next returns the next raw byte, or the error rawStdin hit.
+func (g *stdinGate) next() (byte, error) {
+	select {
+	case b := <-g.raw:
+		return b, nil
+	case err := <-g.rawErr:
+		return 0, err
+	}
+}
+
+// readNoEchoLine reads a single line from g.raw without echoing any of
+// it, handling Backspace and Ctrl+C itself -- the same as
+// term.ReadPassword, which it replaces, since rawStdin already owns reads
+// from the underlying file descriptor.
+func (g *stdinGate) readNoEchoLine() lineResult {
+	var line []byte
+	for {
+		b, err := g.next()
+		if nil != err {
+			g.err = err
+			return lineResult{err: err}
+		}
+		switch b {
+		case '\r', '\n':
+			return lineResult{line: string(line)}
+		case 0x7f, 0x08: /* Backspace */
+			if 0 < len(line) {
+				line = line[:len(line)-1]
+			}
+		case 0x03: /* Ctrl+C */
+			return lineResult{err: fmt.Errorf("keyboard interrupt")}
+		default:
+			line = append(line, b)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestPWDetectorMatch(t *testing.T) {
+	var out bytes.Buffer
+	pending := make(chan struct{}, 1)
+	d := &pwDetector{
+		w:       &out,
+		re:      regexp.MustCompile(defaultPWPrompt),
+		pending: pending,
+	}
+
+	n, err := d.Write([]byte("Password: "))
+	if nil != err {
+		t.Fatalf("Write: %v", err)
+	}
+	if n != len("Password: ") {
+		t.Errorf("Write: got n=%d, want %d", n, len("Password: "))
+	}
+	if "Password: " != out.String() {
+		t.Errorf("underlying writer: got %q, want %q", out.String(), "Password: ")
+	}
+
+	select {
+	case <-pending:
+	default:
+		t.Error("no pending signal after a matching prompt")
+	}
+}
+
+func TestPWDetectorNoMatch(t *testing.T) {
+	var out bytes.Buffer
+	pending := make(chan struct{}, 1)
+	d := &pwDetector{
+		w:       &out,
+		re:      regexp.MustCompile(defaultPWPrompt),
+		pending: pending,
+	}
+
+	if _, err := d.Write([]byte("$ ")); nil != err {
+		t.Fatalf("Write: %v", err)
+	}
+
+	select {
+	case <-pending:
+		t.Error("unexpected pending signal")
+	default:
+	}
+}
+
+// TestPWDetectorBufTrim makes sure only the bytes since the last newline are
+// checked against re, across multiple writes.
+func TestPWDetectorBufTrim(t *testing.T) {
+	var out bytes.Buffer
+	pending := make(chan struct{}, 1)
+	d := &pwDetector{
+		w:       &out,
+		re:      regexp.MustCompile(defaultPWPrompt),
+		pending: pending,
+	}
+
+	if _, err := d.Write([]byte("Password: was wrong\n")); nil != err {
+		t.Fatalf("Write 1: %v", err)
+	}
+	select {
+	case <-pending:
+		t.Fatal("unexpected pending signal before the prompt reappears")
+	default:
+	}
+
+	if _, err := d.Write([]byte("Password: ")); nil != err {
+		t.Fatalf("Write 2: %v", err)
+	}
+	select {
+	case <-pending:
+	default:
+		t.Error("no pending signal after the prompt reappeared")
+	}
+}
+
+// TestPWDetectorPendingNonBlocking makes sure a second match doesn't block
+// on an already-pending signal.
+func TestPWDetectorPendingNonBlocking(t *testing.T) {
+	var out bytes.Buffer
+	pending := make(chan struct{}, 1)
+	d := &pwDetector{
+		w:       &out,
+		re:      regexp.MustCompile(defaultPWPrompt),
+		pending: pending,
+	}
+
+	if _, err := d.Write([]byte("Password: ")); nil != err {
+		t.Fatalf("Write 1: %v", err)
+	}
+	if _, err := d.Write([]byte("Password: ")); nil != err {
+		t.Fatalf("Write 2: %v", err)
+	}
+
+	<-pending
+	select {
+	case <-pending:
+		t.Error("unexpected second pending signal")
+	default:
+	}
+}
+
+// TestStdinGateDivertsMidRead makes sure a pending signal is acted on the
+// next time Read is called, even though that's logically in the middle of
+// the caller's still-in-flight previous read -- the scenario the old
+// select-before-ReadLine code got wrong, since the call reading "secret"'s
+// first byte is indistinguishable to the gate from any other Read call.
+func TestStdinGateDivertsMidRead(t *testing.T) {
+	raw := make(chan byte, 64)
+	rawErr := make(chan error, 1)
+	pending := make(chan struct{}, 1)
+	pwLines := make(chan lineResult, 1)
+	g := &stdinGate{raw: raw, rawErr: rawErr, pending: pending, pwLines: pwLines}
+
+	pending <- struct{}{}
+	for _, b := range []byte("secret\rX") {
+		raw <- b
+	}
+
+	var p [1]byte
+	n, err := g.Read(p[:])
+	if nil != err {
+		t.Fatalf("Read: %v", err)
+	}
+	if 1 != n || 'X' != p[0] {
+		t.Errorf("Read: got (%d, %q), want (1, %q)", n, p[0], 'X')
+	}
+
+	select {
+	case lr := <-pwLines:
+		if nil != lr.err {
+			t.Errorf("pwLines error: %v", lr.err)
+		}
+		if "secret" != lr.line {
+			t.Errorf("pwLines line: got %q, want %q", lr.line, "secret")
+		}
+	default:
+		t.Fatal("no result sent on pwLines")
+	}
+}
+
+// TestStdinGateReadNoEchoLineBackspace makes sure readNoEchoLine applies
+// Backspace to the line it's building, the same as a normal editor would.
+func TestStdinGateReadNoEchoLineBackspace(t *testing.T) {
+	raw := make(chan byte, 64)
+	rawErr := make(chan error, 1)
+	g := &stdinGate{raw: raw, rawErr: rawErr}
+
+	for _, b := range []byte{'a', 'b', 0x7f, 0x7f, 'c', 'd', 0x08, '\r'} {
+		raw <- b
+	}
+
+	lr := g.readNoEchoLine()
+	if nil != lr.err {
+		t.Fatalf("readNoEchoLine: %v", lr.err)
+	}
+	if "c" != lr.line {
+		t.Errorf("readNoEchoLine: got %q, want %q", lr.line, "c")
+	}
+}
+
+func TestDefaultPWPrompt(t *testing.T) {
+	re := regexp.MustCompile(defaultPWPrompt)
+
+	for _, s := range []string{
+		"Password: ",
+		"password:",
+		"Enter passphrase for key '/root/.ssh/id_rsa': ",
+		"PIN: ",
+	} {
+		if !re.MatchString(s) {
+			t.Errorf("%q: expected match", s)
+		}
+	}
+
+	for _, s := range []string{
+		"$ ",
+		"Username: ",
+	} {
+		if re.MatchString(s) {
+			t.Errorf("%q: unexpected match", s)
+		}
+	}
+}
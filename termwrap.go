@@ -7,30 +7,54 @@ package main
  * Wrap stdio in a less frustrating terminal
  * By J. Stuart McMurray
  * Created 20180114
- * Last Modified 20180114
+ * Last Modified 20180128
  */
 
 import (
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"regexp"
 	"strings"
-	"unicode"
+	"syscall"
 
-	"github.com/hashicorp/go-immutable-radix"
+	"github.com/creack/pty"
+	"github.com/magisterquis/termwrap/editor"
+	"github.com/magisterquis/termwrap/editor/rline"
+	"github.com/magisterquis/termwrap/editor/xterm"
+	"github.com/magisterquis/termwrap/history"
 
-	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/term"
 )
 
+// defaultHistFile is the default value of -H, before ~ expansion.
+const defaultHistFile = "~/.termwrap_history"
+
+// histMax is the number of lines kept in the history file.
+const histMax = 1000
+
 // WORDLIST holds the autocomplete callback's list of words
-var WORDLIST *iradix.Tree
+var WORDLIST *Wordlist
 
 // ERRORCHAN receives errors which terminate the program
 var ERRORCHAN chan<- error
 
+// HIST is the persistent command history.
+var HIST *history.History
+
+// writerEditor is an editor.Editor which also exposes the io.Writer the
+// child's output should be written to, so it's properly interleaved with
+// whatever the user's typed so far.
+type writerEditor interface {
+	editor.Editor
+	Writer() io.Writer
+}
+
 func main() {
 	var (
 		prompt = flag.String(
@@ -45,6 +69,60 @@ func main() {
 			"If set, uses the lines of `file` as a list of "+
 				"tab-complete words",
 		)
+		histFile = flag.String(
+			"H",
+			defaultHistFile,
+			"Persistent command history `file`",
+		)
+		usePty = flag.Bool(
+			"pty",
+			term.IsTerminal(int(os.Stdin.Fd())),
+			"Run the wrapped command under a pseudo-terminal, "+
+				"for programs which need one (e.g. vim, "+
+				"less, top)",
+		)
+		recFile = flag.String(
+			"r",
+			"",
+			"If set, record the session to `file.cast` in "+
+				"asciicast v2 format",
+		)
+		tLearn = flag.Bool(
+			"tlearn",
+			false,
+			"Learn new tab-complete words from the child's "+
+				"output",
+		)
+		tMin = flag.Int(
+			"tmin",
+			3,
+			"Minimum `length` of a word learned with -tlearn",
+		)
+		tMax = flag.Int(
+			"tmax",
+			5000,
+			"Maximum `number` of words to keep when learning "+
+				"with -tlearn (0 for unlimited)",
+		)
+		tDump = flag.String(
+			"tdump",
+			"",
+			"If set, write learned tab-complete words to "+
+				"`file` on exit",
+		)
+		editorKind = flag.String(
+			"editor",
+			"xterm",
+			"Line-editor `backend` to use: xterm, vim, or emacs",
+		)
+		pwPrompt = flag.String(
+			"pwprompt",
+			defaultPWPrompt,
+			"`Regular expression` matching a password prompt in "+
+				"the child's output; the next input line is "+
+				"read with echo suppressed.  Empty disables "+
+				"this",
+		)
 	)
 	flag.Usage = func() {
 		fmt.Fprintf(
@@ -69,9 +147,15 @@ Options:
 		os.Exit(1)
 	}
 
-	/* Set up autocomplete list */
+	/* Set up autocomplete list.  Without -tlearn, a static -t list is
+	never trimmed.  With -tlearn, -tmax bounds the whole list, -t words
+	included; they were inserted first, so they're evicted first. */
 	if "" != *aFile {
-		if err := parseAList(*aFile); nil != err {
+		max := 0
+		if *tLearn {
+			max = *tMax
+		}
+		if err := parseAList(*aFile, max); nil != err {
 			fmt.Fprintf(
 				os.Stderr,
 				"Unable to parse autocomplete file: %v",
@@ -80,15 +164,56 @@ Options:
 			os.Exit(5)
 		}
 	}
+	if *tLearn && nil == WORDLIST {
+		WORDLIST = NewWordlist(*tMax)
+	}
+
+	/* Set up password-prompt detection */
+	var pwRE *regexp.Regexp
+	if "" != *pwPrompt {
+		re, err := regexp.Compile(*pwPrompt)
+		if nil != err {
+			fmt.Fprintf(
+				os.Stderr,
+				"Unable to parse -pwprompt regular expression: %v\n",
+				err,
+			)
+			os.Exit(10)
+		}
+		pwRE = re
+	}
+	pwPending := make(chan struct{}, 1)
+
+	/* Set up persistent history */
+	hfn, err := expandTilde(*histFile)
+	if nil != err {
+		fmt.Fprintf(
+			os.Stderr,
+			"Unable to expand history file name: %v\n",
+			err,
+		)
+		os.Exit(6)
+	}
+	h, err := history.Open(hfn, histMax)
+	if nil != err {
+		fmt.Fprintf(
+			os.Stderr,
+			"Unable to open history file %v: %v\n",
+			hfn,
+			err,
+		)
+		os.Exit(6)
+	}
+	HIST = h
 
 	/* Stdin should probably be a terminal. */
 	infd := int(os.Stdin.Fd())
-	if !terminal.IsTerminal(infd) {
+	if !term.IsTerminal(infd) {
 		fmt.Fprintf(os.Stderr, "Warning: stdin isn't a tty.\n")
 	}
 
 	/* Set stdin to raw mode, wrap stdio */
-	ps, err := terminal.MakeRaw(infd)
+	ps, err := term.MakeRaw(infd)
 	if nil != err {
 		fmt.Fprintf(
 			os.Stderr,
@@ -100,7 +225,7 @@ Options:
 
 	/* Restore terminal when we're done */
 	defer func() {
-		if err := terminal.Restore(infd, ps); nil != err {
+		if err := term.Restore(infd, ps); nil != err {
 			fmt.Fprintf(
 				os.Stderr,
 				"Unable to restore stdin: %v\r\n",
@@ -114,179 +239,269 @@ Options:
 	ech := make(chan error)
 	ERRORCHAN = ech
 
-	/* Wrap stdio in a terminal */
-	t := terminal.NewTerminal(
-		struct {
-			io.Reader
-			io.Writer
-		}{
-			os.Stdin,
-			os.Stdout,
-		},
-		*prompt,
-	)
-	t.AutoCompleteCallback = autoCompleteCallback
+	/* Record the session, if asked */
+	var out io.Writer = os.Stdout
+	if "" != *recFile {
+		w, h, err := term.GetSize(infd)
+		if nil != err {
+			w, h = 80, 24
+		}
+		cw, err := newCastWriter(*recFile, os.Stdout, w, h, flag.Args())
+		if nil != err {
+			fmt.Fprintf(
+				os.Stderr,
+				"Unable to open %v for recording: %v\r\n",
+				*recFile,
+				err,
+			)
+			os.Exit(8)
+		}
+		CAST = cw
+		out = cw
+	}
 
-	/* Start program, hook up stdio */
-	c := exec.Command(flag.Arg(0), flag.Args()[1:]...)
-	c.Stdout = t
-	c.Stderr = t
-	in, err := c.StdinPipe()
-	if nil != err {
+	/* Set up the chosen line-editor backend */
+	switch *editorKind {
+	case "xterm", "vim", "emacs": /* Valid */
+	default:
 		fmt.Fprintf(
 			os.Stderr,
-			"Unable to get child's stdin: %v\r\n",
-			err,
+			"Invalid -editor %q; must be one of xterm, vim, emacs\n",
+			*editorKind,
 		)
-		os.Exit(4)
+		os.Exit(11)
+	}
+	/* Stdin is read by one goroutine and handed to the editor through
+	gate, so a password prompt detected while the editor's already
+	blocked waiting for the next line can still claim its answer; see
+	stdinGate. */
+	rawCh := make(chan byte, 64)
+	rawErrc := make(chan error, 1)
+	go rawStdin(os.Stdin, rawCh, rawErrc)
+	pwLines := make(chan lineResult)
+	gate := &stdinGate{
+		raw:     rawCh,
+		rawErr:  rawErrc,
+		pending: pwPending,
+		pwLines: pwLines,
+	}
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{gate, out}
+	var ed writerEditor
+	switch *editorKind {
+	case "vim", "emacs":
+		re, err := rline.New(rw, out, *prompt, "vim" == *editorKind, hfn)
+		if nil != err {
+			fmt.Fprintf(
+				os.Stderr,
+				"Unable to start the %v editor: %v\r\n",
+				*editorKind,
+				err,
+			)
+			os.Exit(9)
+		}
+		ed = re
+	default:
+		ed = xterm.New(rw, *prompt, HIST, ech)
 	}
+	ed.SetCompleter(completeWord)
+	defer ed.Close()
 
-	/* Proxy input */
+	/* Start program, hook up stdio */
+	c := exec.Command(flag.Arg(0), flag.Args()[1:]...)
+	var childOut io.Writer = ed.Writer()
+	if *tLearn {
+		childOut = &learnWriter{w: childOut, wl: WORDLIST, min: *tMin}
+	}
+	if nil != pwRE {
+		childOut = &pwDetector{w: childOut, re: pwRE, pending: pwPending}
+	}
+	var childIn io.Writer
+	if *usePty {
+		childIn = startPTY(c, childOut, infd)
+	} else {
+		childIn = startPipes(c, childOut)
+	}
+
+	/* Proxy input.  ed.ReadLine runs in its own goroutine, feeding
+	edLines, since stdinGate needs to be able to report a password
+	line on pwLines while ed.ReadLine is still blocked inside the
+	line after it. */
+	edLines := make(chan lineResult)
 	go func() {
 		for {
-			/* Get a line */
-			l, err := t.ReadLine()
+			l, err := ed.ReadLine()
+			edLines <- lineResult{line: l, err: err}
 			if nil != err {
-				ERRORCHAN <- err
 				return
 			}
+		}
+	}()
+	go func() {
+		for {
+			/* Get a line, with echo suppressed if it's the
+			child's password prompt that gate diverted. */
+			var lr lineResult
+			var noEcho bool
+			select {
+			case lr = <-edLines:
+			case lr = <-pwLines:
+				noEcho = true
+			}
+			if nil != lr.err {
+				ERRORCHAN <- lr.err
+				return
+			}
+			l := lr.line
+			/* Both backends keep the -H file up to date themselves: the
+			xterm backend appends every submitted line via the
+			term.Terminal.History it's given, and the rline
+			backend keeps its own history file via -H.  A line
+			gate diverts to a password read never reaches either
+			backend, so it never touches history. */
+			/* Record it, if we're recording.  Secrets are
+			elided, so they don't end up in the asciicast. */
+			if nil != CAST {
+				rl := l
+				if noEcho {
+					rl = "***"
+				}
+				if err := CAST.InputEvent(rl); nil != err {
+					fmt.Fprintf(
+						os.Stderr,
+						"Unable to record input: %v\r\n",
+						err,
+					)
+				}
+			}
 			/* Send it to the child */
-			if _, err := in.Write([]byte(l + "\n")); nil != err {
+			if _, err := childIn.Write([]byte(l + "\n")); nil != err {
 				ERRORCHAN <- err
 				return
 			}
 		}
 	}()
 
-	/* Start child */
-	go func() {
-		ERRORCHAN <- c.Run()
-	}()
-
 	/* Wait for something */
 	if err := <-ech; nil != err && io.EOF != err {
 		fmt.Fprintf(os.Stderr, "Fatal error: %v\r\n", err)
 	}
-}
-
-/* parseAList reads the lines from fn and turns them into a radix tree for
-the autocomplete callback */
-func parseAList(fn string) error {
-	WORDLIST = iradix.New()
 
-	/* Slurp file */
-	b, err := ioutil.ReadFile(fn)
-	if nil != err {
-		return err
-	}
-
-	/* Add each line to the tree */
-	for _, line := range strings.Split(string(b), "\n") {
-		l := strings.TrimSpace(line)
-		if "" == l {
-			continue
+	/* Save what we've learned, if asked */
+	if "" != *tDump && nil != WORDLIST {
+		if err := WORDLIST.Dump(*tDump); nil != err {
+			fmt.Fprintf(
+				os.Stderr,
+				"Unable to save learned words to %v: %v\r\n",
+				*tDump,
+				err,
+			)
 		}
-		WORDLIST, _, _ = WORDLIST.Insert([]byte(l), nil)
 	}
-
-	return nil
 }
 
-/* autoCompleteCallback provides autocompletion for the terminal */
-func autoCompleteCallback(
-	line string,
-	pos int,
-	key rune,
-) (newLine string, newPos int, ok bool) {
-	switch key {
-	case 0x03: /* Ctrl+C */
-		/* Quit if it's an empty line */
-		if "" == line {
-			ERRORCHAN <- fmt.Errorf("keyboard interrupt")
-			return "", 0, false
-		}
-		/* Clear the line otherwise */
-		return "", 0, true
-	case '\t': /* Tab, for autocomplete */
-		break
-	default:
-		return "", 0, false
+/* startPTY runs c attached to a pseudo-terminal, whose size is taken from
+the terminal on file descriptor infd.  The master side is drained into out,
+and SIGWINCH on infd is forwarded to the child.  The returned io.Writer
+sends data to the child's stdin. */
+func startPTY(c *exec.Cmd, out io.Writer, infd int) io.Writer {
+	m, err := pty.Start(c)
+	if nil != err {
+		fmt.Fprintf(
+			os.Stderr,
+			"Unable to start %v in a pty: %v\r\n",
+			c.Path,
+			err,
+		)
+		os.Exit(7)
 	}
 
-	/* If we have no set of completion words, give up */
-	if nil == WORDLIST {
-		return "", 0, false
-	}
+	/* Size the pty to match the outer terminal, and keep it that way */
+	resizePTY(m, infd)
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resizePTY(m, infd)
+		}
+	}()
 
-	/* Get word on which tab was called */
-	start := pos - 1
-	if 0 > start {
-		start = 0
-	}
-	for ; 0 < start && !unicode.IsSpace(rune(line[start-1])); start-- {
-	}
-	word := line[start:pos]
+	/* Copy the child's output to our terminal */
+	go func() {
+		_, err := io.Copy(out, m)
+		ERRORCHAN <- err
+	}()
 
-	/* Find matches */
-	ms := []string{}
-	WORDLIST.Root().WalkPrefix(
-		[]byte(word),
-		func(k []byte, v interface{}) bool {
-			ms = append(ms, string(k))
-			return false
-		},
-	)
+	/* Reap the child */
+	go func() {
+		ERRORCHAN <- c.Wait()
+	}()
 
-	/* If there's no matches, do nothing */
-	if 0 == len(ms) {
-		return "", 0, false
-	}
+	return m
+}
 
-	/* Find the longest common prefix */
-	lcp := longestCommonPrefix(ms)
+/* resizePTY sets m's window size to match the terminal on infd */
+func resizePTY(m *os.File, infd int) {
+	w, h, err := term.GetSize(infd)
+	if nil != err {
+		return
+	}
+	pty.Setsize(m, &pty.Winsize{Rows: uint16(h), Cols: uint16(w)})
+}
 
-	/* If there isn't one, line's unchanged */
-	if 0 == len(lcp) {
-		return "", 0, false
+/* startPipes runs c with plain pipes hooked up to out, for use when a pty
+isn't wanted or available.  The returned io.Writer sends data to the
+child's stdin. */
+func startPipes(c *exec.Cmd, out io.Writer) io.Writer {
+	c.Stdout = out
+	c.Stderr = out
+	in, err := c.StdinPipe()
+	if nil != err {
+		fmt.Fprintf(
+			os.Stderr,
+			"Unable to get child's stdin: %v\r\n",
+			err,
+		)
+		os.Exit(4)
 	}
 
-	/* Put the prefix into the line */
-	left := line[:start]
-	right := line[pos:]
-	return left + lcp + right, pos + (len(lcp) - len(word)), true
+	go func() {
+		ERRORCHAN <- c.Run()
+	}()
 
+	return in
 }
 
-/* longestCommonPrefix finds the longest prefix shared between the strings. */
-func longestCommonPrefix(ss []string) string {
-	/* If there was no match, there's no prefix */
-	if 0 == len(ss) {
-		return ""
+/* expandTilde replaces a leading ~ in fn with the current user's home
+directory */
+func expandTilde(fn string) (string, error) {
+	if !strings.HasPrefix(fn, "~") {
+		return fn, nil
 	}
-	/* If we have only one match, it's the answer */
-	if 1 == len(ss) {
-		return ss[0]
+	u, err := user.Current()
+	if nil != err {
+		return "", err
 	}
+	return filepath.Join(u.HomeDir, strings.TrimPrefix(fn, "~")), nil
+}
 
-	/* Find the min and max strings */
-	min := ss[0]
-	max := ss[0]
-	for _, s := range ss[1:] {
-		if s > max {
-			max = s
-		} else if s < min {
-			min = s
-		}
+/* completeWord returns WORDLIST's words starting with prefix; it's handed
+to whichever editor backend is in use via SetCompleter */
+func completeWord(prefix string) []string {
+	if nil == WORDLIST {
+		return nil
 	}
 
-	/* The common prefix between the minimum and maximum strings is the
-	prefix common to all strings */
-	pref := ""
-	for i := 0; len(min) > i && len(max) > i; i++ {
-		if min[i] != max[i] {
-			break
-		}
-		pref += string(min[i])
-	}
-	return pref
+	var ms []string
+	WORDLIST.Snapshot().Root().WalkPrefix(
+		[]byte(prefix),
+		func(k []byte, v interface{}) bool {
+			ms = append(ms, string(k))
+			return false
+		},
+	)
+	return ms
 }
+